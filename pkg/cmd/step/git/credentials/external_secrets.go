@@ -0,0 +1,70 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/jenkins-x/jx/pkg/vault"
+	"github.com/pkg/errors"
+	secretmanagerpb "google.golang.org/genproto/googleapis/cloud/secretmanager/v1"
+)
+
+// createVaultClient creates a Vault API client using whichever auth method (approle or
+// Kubernetes auth) the ambient VaultClientFactory is already configured with, the same discovery
+// jx uses elsewhere when talking to Vault. Selecting a role or auth path per --source is not
+// supported; all vault:// sources share this single ambient client.
+func createVaultClient() (vault.Client, error) {
+	factory := vault.NewVaultClientFactory()
+	return factory.NewVaultClient("", "")
+}
+
+// readAWSSecretsManagerJSONSecret fetches a secret by ARN and decodes its JSON document into a
+// string map, expecting user/token/url keys
+func readAWSSecretsManagerJSONSecret(secretARN string) (map[string]string, error) {
+	sess, err := session.NewSession(aws.NewConfig())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating AWS session")
+	}
+	svc := secretsmanager.New(sess)
+
+	result, err := svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting secret value for %s", secretARN)
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal([]byte(aws.StringValue(result.SecretString)), &values); err != nil {
+		return nil, errors.Wrapf(err, "parsing JSON secret %s", secretARN)
+	}
+	return values, nil
+}
+
+// readGCPSecretManagerJSONSecret fetches a secret version by resource name and decodes its JSON
+// payload into a string map, expecting user/token/url keys
+func readGCPSecretManagerJSONSecret(name string) (map[string]string, error) {
+	ctx := context.Background()
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating GCP Secret Manager client")
+	}
+	defer client.Close()
+
+	result, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: name,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "accessing secret version %s", name)
+	}
+
+	values := map[string]string{}
+	if err := json.Unmarshal(result.Payload.Data, &values); err != nil {
+		return nil, errors.Wrapf(err, "parsing JSON secret %s", name)
+	}
+	return values, nil
+}
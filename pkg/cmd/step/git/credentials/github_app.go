@@ -0,0 +1,229 @@
+package credentials
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/jenkins-x/jx/pkg/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	optionGitHubAppSecret = "github-app-secret"
+
+	githubAppJWTValidity = 10 * time.Minute
+
+	githubAppUser = "x-access-token"
+)
+
+// githubAppInstallationToken is a cached installation access token
+type githubAppInstallationToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// githubAppTokenCache caches installation tokens in-memory keyed by installation ID so that
+// a long running process (e.g. with --refresh-interval) doesn't mint a new token on every run
+type githubAppTokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]*githubAppInstallationToken
+}
+
+var defaultGitHubAppTokenCache = &githubAppTokenCache{
+	tokens: map[string]*githubAppInstallationToken{},
+}
+
+// isGitHubAppSecret returns true if the secret contains the keys required to mint installation tokens
+func isGitHubAppSecret(secret *corev1.Secret) bool {
+	if secret == nil {
+		return false
+	}
+	return len(secret.Data["githubAppId"]) > 0 && len(secret.Data["githubAppInstallationId"]) > 0 && len(secret.Data["privateKey"]) > 0
+}
+
+// createGitHubAppCredentials mints (or reuses a cached) GitHub App installation token for the
+// app/installation described by the given secret and returns it as git credentials
+func (o *StepGitCredentialsOptions) createGitHubAppCredentials(secret *corev1.Secret) (*credentials, error) {
+	appID := string(secret.Data["githubAppId"])
+	installationID := string(secret.Data["githubAppInstallationId"])
+	privateKeyPEM := secret.Data["privateKey"]
+	serviceURL := string(secret.Data["url"])
+	if serviceURL == "" {
+		serviceURL = "https://github.com"
+	}
+
+	token, err := o.gitHubAppInstallationToken(appID, installationID, privateKeyPEM, githubAPIBaseURL(serviceURL))
+	if err != nil {
+		return nil, errors.Wrapf(err, "obtaining installation token for installation %s", installationID)
+	}
+
+	return &credentials{
+		user:       githubAppUser,
+		password:   token,
+		serviceURL: serviceURL,
+	}, nil
+}
+
+// gitHubAppInstallationToken returns a cached installation token if one is still valid, otherwise
+// mints a new JWT and exchanges it for a fresh installation token
+func (o *StepGitCredentialsOptions) gitHubAppInstallationToken(appID string, installationID string, privateKeyPEM []byte, apiBaseURL string) (string, error) {
+	defaultGitHubAppTokenCache.mu.Lock()
+	defer defaultGitHubAppTokenCache.mu.Unlock()
+
+	if cached, ok := defaultGitHubAppTokenCache.tokens[installationID]; ok {
+		if time.Now().Before(cached.expiresAt.Add(-30 * time.Second)) {
+			return cached.token, nil
+		}
+	}
+
+	jwtToken, err := createGitHubAppJWT(appID, privateKeyPEM)
+	if err != nil {
+		return "", errors.Wrap(err, "creating github app jwt")
+	}
+
+	token, expiresAt, err := exchangeGitHubAppInstallationToken(apiBaseURL, installationID, jwtToken)
+	if err != nil {
+		return "", errors.Wrap(err, "exchanging installation token")
+	}
+
+	defaultGitHubAppTokenCache.tokens[installationID] = &githubAppInstallationToken{
+		token:     token,
+		expiresAt: expiresAt,
+	}
+	return token, nil
+}
+
+// createGitHubAppJWT builds a short lived RS256 JWT identifying the GitHub App, as described in
+// https://docs.github.com/en/developers/apps/building-github-apps/authenticating-with-github-apps
+func createGitHubAppJWT(appID string, privateKeyPEM []byte) (string, error) {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		return "", errors.New("failed to decode PEM block from privateKey")
+	}
+
+	privateKey, err := parseRSAPrivateKey(block.Bytes)
+	if err != nil {
+		return "", errors.Wrap(err, "parsing RSA private key")
+	}
+
+	now := time.Now()
+	claims := jwt.StandardClaims{
+		IssuedAt:  now.Add(-30 * time.Second).Unix(),
+		ExpiresAt: now.Add(githubAppJWTValidity).Unix(),
+		Issuer:    appID,
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	return token.SignedString(privateKey)
+}
+
+// parseRSAPrivateKey parses either a PKCS1 or PKCS8 encoded RSA private key
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("privateKey is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// githubAPIBaseURL derives the GitHub API base URL to mint installation tokens against from the
+// git server URL: github.com uses the public api.github.com host, anything else is assumed to be
+// a GitHub Enterprise server using its documented /api/v3 API path
+func githubAPIBaseURL(serviceURL string) string {
+	u, err := url.Parse(serviceURL)
+	if err != nil || u.Host == "" || u.Host == "github.com" {
+		return "https://api.github.com"
+	}
+
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v3", scheme, u.Host)
+}
+
+// exchangeGitHubAppInstallationToken exchanges a GitHub App JWT for an installation access token
+func exchangeGitHubAppInstallationToken(apiBaseURL string, installationID string, jwtToken string) (string, time.Time, error) {
+	u := fmt.Sprintf("%s/app/installations/%s/access_tokens", apiBaseURL, installationID)
+	req, err := http.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("failed to create installation token, status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Token     string `json:"token"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "parsing installation token response")
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, result.ExpiresAt)
+	if err != nil {
+		expiresAt = time.Now().Add(55 * time.Minute)
+	}
+	return result.Token, expiresAt, nil
+}
+
+// runWithGitHubAppRefresh regenerates the credentials file before the installation token expires,
+// keeping long-lived Tekton sidecars authenticated without operator intervention
+func (o *StepGitCredentialsOptions) runWithGitHubAppRefresh(outFile string, secret *corev1.Secret) error {
+	for {
+		creds, err := o.createGitHubAppCredentials(secret)
+		if err != nil {
+			return err
+		}
+		if err := o.createGitCredentialsFile(outFile, []credentials{*creds}); err != nil {
+			return err
+		}
+
+		installationID := string(secret.Data["githubAppInstallationId"])
+		defaultGitHubAppTokenCache.mu.Lock()
+		cached := defaultGitHubAppTokenCache.tokens[installationID]
+		defaultGitHubAppTokenCache.mu.Unlock()
+
+		sleepFor := o.RefreshInterval
+		if cached != nil {
+			// wake once the cache stops reusing this token (30s before expiry), so a fresh one is minted
+			untilExpiry := time.Until(cached.expiresAt) - 30*time.Second
+			if untilExpiry > 0 && untilExpiry < sleepFor {
+				sleepFor = untilExpiry
+			}
+		}
+		log.Logger().Infof("Refreshing GitHub App installation token in %s", sleepFor)
+		time.Sleep(sleepFor)
+	}
+}
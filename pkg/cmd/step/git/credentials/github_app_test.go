@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestIsGitHubAppSecret(t *testing.T) {
+	assert.False(t, isGitHubAppSecret(nil))
+	assert.False(t, isGitHubAppSecret(&corev1.Secret{}))
+	assert.False(t, isGitHubAppSecret(&corev1.Secret{Data: map[string][]byte{
+		"githubAppId": []byte("1"),
+	}}))
+	assert.True(t, isGitHubAppSecret(&corev1.Secret{Data: map[string][]byte{
+		"githubAppId":             []byte("1"),
+		"githubAppInstallationId": []byte("2"),
+		"privateKey":              []byte("key"),
+	}}))
+}
+
+func TestGithubAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		serviceURL string
+		want       string
+	}{
+		{"https://github.com", "https://api.github.com"},
+		{"", "https://api.github.com"},
+		{"https://github.mycompany.com", "https://github.mycompany.com/api/v3"},
+		{"http://github.mycompany.com", "http://github.mycompany.com/api/v3"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, githubAPIBaseURL(tt.serviceURL), "serviceURL %q", tt.serviceURL)
+	}
+}
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestParseRSAPrivateKeyPKCS1(t *testing.T) {
+	key := generateTestRSAKey(t)
+	der := x509.MarshalPKCS1PrivateKey(key)
+
+	parsed, err := parseRSAPrivateKey(der)
+	require.NoError(t, err)
+	assert.Equal(t, key.N, parsed.N)
+}
+
+func TestParseRSAPrivateKeyPKCS8(t *testing.T) {
+	key := generateTestRSAKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	parsed, err := parseRSAPrivateKey(der)
+	require.NoError(t, err)
+	assert.Equal(t, key.N, parsed.N)
+}
+
+func TestParseRSAPrivateKeyInvalid(t *testing.T) {
+	_, err := parseRSAPrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+func TestCreateGitHubAppJWTClaims(t *testing.T) {
+	key := generateTestRSAKey(t)
+	privatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	before := time.Now()
+	tokenString, err := createGitHubAppJWT("12345", privatePEM)
+	require.NoError(t, err)
+
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	require.NoError(t, err)
+
+	claims, ok := token.Claims.(*jwt.StandardClaims)
+	require.True(t, ok)
+	assert.Equal(t, "12345", claims.Issuer)
+	assert.True(t, claims.IssuedAt <= before.Unix())
+	assert.True(t, claims.ExpiresAt > before.Unix())
+	assert.Equal(t, githubAppJWTValidity, time.Unix(claims.ExpiresAt, 0).Sub(time.Unix(claims.IssuedAt, 0))-30*time.Second)
+}
@@ -0,0 +1,257 @@
+package credentials
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/jenkins-x/jx/pkg/auth"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const optionSource = "source"
+
+// credentialSourcesFile is the default location of the declarative sources config, relative to
+// the current working directory, used when --source is not specified
+const credentialSourcesFile = "credential-sources.yaml"
+
+// CredentialSource fetches one or more sets of git credentials from a backend such as a
+// Kubernetes Secret, the jx auth config, or an external secret store
+type CredentialSource interface {
+	Fetch() ([]credentials, error)
+}
+
+// credentialSourcesConfig is the schema of credential-sources.yaml
+type credentialSourcesConfig struct {
+	Sources []string `json:"sources"`
+}
+
+// kubeSecretSource reads user/token/url from a Kubernetes Secret, the existing behaviour of
+// --credentials-secret
+type kubeSecretSource struct {
+	options    *StepGitCredentialsOptions
+	secretName string
+}
+
+func (s *kubeSecretSource) Fetch() ([]credentials, error) {
+	kubeClient, ns, err := s.options.KubeClientAndDevNamespace()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := kubeClient.CoreV1().Secrets(ns).Get(s.secretName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed to find secret '%s' in namespace '%s'", s.secretName, ns)
+	}
+
+	if isGitHubAppSecret(secret) {
+		creds, err := s.options.createGitHubAppCredentials(secret)
+		if err != nil {
+			return nil, err
+		}
+		return []credentials{*creds}, nil
+	}
+
+	return []credentials{{
+		user:       string(secret.Data["user"]),
+		password:   string(secret.Data["token"]),
+		serviceURL: string(secret.Data["url"]),
+	}}, nil
+}
+
+// authConfigSource reads credentials from the jx auth ConfigService, the existing default
+// behaviour when no secret is specified
+type authConfigSource struct {
+	options       *StepGitCredentialsOptions
+	authConfigSvc auth.ConfigService
+}
+
+func (s *authConfigSource) Fetch() ([]credentials, error) {
+	return s.options.CreateGitCredentialsFromAuthService(s.authConfigSvc)
+}
+
+// fileSource reads a YAML file containing a list of credentials
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) Fetch() ([]credentials, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading credential source file %s", s.path)
+	}
+
+	var parsed struct {
+		Credentials []struct {
+			User     string `json:"user"`
+			Password string `json:"password"`
+			URL      string `json:"url"`
+		} `json:"credentials"`
+	}
+	if err := yaml.Unmarshal(data, &parsed); err != nil {
+		return nil, errors.Wrapf(err, "parsing credential source file %s", s.path)
+	}
+
+	var result []credentials
+	for _, c := range parsed.Credentials {
+		result = append(result, credentials{user: c.User, password: c.Password, serviceURL: c.URL})
+	}
+	return result, nil
+}
+
+// vaultSource fetches a user/token pair from a HashiCorp Vault KV v2 secret, using whichever
+// Vault auth method (approle or Kubernetes auth) createVaultClient's ambient client factory is
+// configured with. Per-source role/auth-path selection is out of scope; every vaultSource shares
+// that one ambient client.
+type vaultSource struct {
+	path       string
+	url        string
+	tokenField string
+}
+
+func (s *vaultSource) Fetch() ([]credentials, error) {
+	vaultClient, err := createVaultClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating vault client")
+	}
+
+	secretValues, err := vaultClient.ReadSecret(s.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading vault secret %s", s.path)
+	}
+
+	return []credentials{{
+		user:       secretValues["user"],
+		password:   secretValues[s.tokenField],
+		serviceURL: s.url,
+	}}, nil
+}
+
+// awsSecretsManagerSource fetches a user/token pair from an AWS Secrets Manager secret containing
+// a JSON document with user/token/url keys
+type awsSecretsManagerSource struct {
+	secretARN string
+	url       string
+}
+
+func (s *awsSecretsManagerSource) Fetch() ([]credentials, error) {
+	secretValues, err := readAWSSecretsManagerJSONSecret(s.secretARN)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading AWS Secrets Manager secret %s", s.secretARN)
+	}
+
+	serviceURL := s.url
+	if serviceURL == "" {
+		serviceURL = secretValues["url"]
+	}
+	return []credentials{{
+		user:       secretValues["user"],
+		password:   secretValues["token"],
+		serviceURL: serviceURL,
+	}}, nil
+}
+
+// gcpSecretManagerSource fetches a user/token pair from a GCP Secret Manager secret version
+type gcpSecretManagerSource struct {
+	name string
+	url  string
+}
+
+func (s *gcpSecretManagerSource) Fetch() ([]credentials, error) {
+	secretValues, err := readGCPSecretManagerJSONSecret(s.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading GCP Secret Manager secret %s", s.name)
+	}
+
+	serviceURL := s.url
+	if serviceURL == "" {
+		serviceURL = secretValues["url"]
+	}
+	return []credentials{{
+		user:       secretValues["user"],
+		password:   secretValues["token"],
+		serviceURL: serviceURL,
+	}}, nil
+}
+
+// awsSMPrefix is the --source prefix for an AWS Secrets Manager ARN. ARNs contain multiple
+// colons (arn:aws:secretsmanager:region:account:secret:name), which net/url's authority parsing
+// can't handle as a host, so this scheme is parsed from the raw string rather than via url.Parse.
+const awsSMPrefix = "aws-sm://"
+
+// parseCredentialSource parses one --source flag value, e.g.
+// vault://secret/data/git/github?field=token&url=https://github.com
+// aws-sm://arn:aws:secretsmanager:...:secret:github?url=https://github.com
+// gcp-sm://projects/my-project/secrets/github/versions/latest
+// file:///path/to/credentials.yaml
+func (o *StepGitCredentialsOptions) parseCredentialSource(raw string) (CredentialSource, error) {
+	if strings.HasPrefix(raw, awsSMPrefix) {
+		arn, query := strings.TrimPrefix(raw, awsSMPrefix), ""
+		if idx := strings.Index(arn, "?"); idx >= 0 {
+			arn, query = arn[:idx], arn[idx+1:]
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing --source value %q", raw)
+		}
+		return &awsSecretsManagerSource{secretARN: arn, url: values.Get("url")}, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing --source value %q", raw)
+	}
+
+	switch u.Scheme {
+	case "vault":
+		field := u.Query().Get("field")
+		if field == "" {
+			field = "token"
+		}
+		return &vaultSource{
+			path:       strings.TrimPrefix(u.Host+u.Path, "/"),
+			url:        u.Query().Get("url"),
+			tokenField: field,
+		}, nil
+	case "gcp-sm":
+		return &gcpSecretManagerSource{
+			name: u.Host + u.Path,
+			url:  u.Query().Get("url"),
+		}, nil
+	case "file":
+		return &fileSource{path: u.Path}, nil
+	case "kube-secret", "secret":
+		return &kubeSecretSource{options: o, secretName: u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --source scheme %q, must be one of: vault, aws-sm, gcp-sm, file, kube-secret", u.Scheme)
+	}
+}
+
+// credentialSources builds the list of CredentialSource to fetch from, based on the repeatable
+// --source flag, falling back to credential-sources.yaml if present
+func (o *StepGitCredentialsOptions) credentialSources() ([]CredentialSource, error) {
+	raw := o.Sources
+	if len(raw) == 0 {
+		if data, err := ioutil.ReadFile(credentialSourcesFile); err == nil {
+			var cfg credentialSourcesConfig
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				return nil, errors.Wrapf(err, "parsing %s", credentialSourcesFile)
+			}
+			raw = cfg.Sources
+		}
+	}
+
+	var sources []CredentialSource
+	for _, r := range raw {
+		source, err := o.parseCredentialSource(r)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
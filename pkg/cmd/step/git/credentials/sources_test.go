@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCredentialSource(t *testing.T) {
+	o := &StepGitCredentialsOptions{}
+
+	t.Run("vault defaults to token field", func(t *testing.T) {
+		source, err := o.parseCredentialSource("vault://secret/data/git/github?url=https://github.com")
+		assert.NoError(t, err)
+		vault, ok := source.(*vaultSource)
+		assert.True(t, ok)
+		assert.Equal(t, "secret/data/git/github", vault.path)
+		assert.Equal(t, "https://github.com", vault.url)
+		assert.Equal(t, "token", vault.tokenField)
+	})
+
+	t.Run("vault honours field query param", func(t *testing.T) {
+		source, err := o.parseCredentialSource("vault://secret/data/git/github?field=apiToken&url=https://github.com")
+		assert.NoError(t, err)
+		vault, ok := source.(*vaultSource)
+		assert.True(t, ok)
+		assert.Equal(t, "apiToken", vault.tokenField)
+	})
+
+	t.Run("aws-sm ARN with multiple colons", func(t *testing.T) {
+		source, err := o.parseCredentialSource("aws-sm://arn:aws:secretsmanager:us-east-1:123456789012:secret:github?url=https://github.com")
+		assert.NoError(t, err)
+		aws, ok := source.(*awsSecretsManagerSource)
+		assert.True(t, ok)
+		assert.Equal(t, "arn:aws:secretsmanager:us-east-1:123456789012:secret:github", aws.secretARN)
+		assert.Equal(t, "https://github.com", aws.url)
+	})
+
+	t.Run("aws-sm ARN without query string", func(t *testing.T) {
+		source, err := o.parseCredentialSource("aws-sm://arn:aws:secretsmanager:us-east-1:123456789012:secret:github")
+		assert.NoError(t, err)
+		aws, ok := source.(*awsSecretsManagerSource)
+		assert.True(t, ok)
+		assert.Equal(t, "arn:aws:secretsmanager:us-east-1:123456789012:secret:github", aws.secretARN)
+		assert.Equal(t, "", aws.url)
+	})
+
+	t.Run("gcp-sm", func(t *testing.T) {
+		source, err := o.parseCredentialSource("gcp-sm://projects/my-project/secrets/github/versions/latest")
+		assert.NoError(t, err)
+		gcp, ok := source.(*gcpSecretManagerSource)
+		assert.True(t, ok)
+		assert.Equal(t, "projects/my-project/secrets/github/versions/latest", gcp.name)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := o.parseCredentialSource("ftp://nope")
+		assert.Error(t, err)
+	})
+}
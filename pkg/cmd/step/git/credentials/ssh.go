@@ -0,0 +1,295 @@
+package credentials
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x/jx/pkg/auth"
+	"github.com/jenkins-x/jx/pkg/gits"
+	"github.com/jenkins-x/jx/pkg/log"
+	"github.com/jenkins-x/jx/pkg/util"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshKeyPair is a generated SSH keypair ready to be persisted and optionally uploaded
+type sshKeyPair struct {
+	host       string
+	privatePEM []byte
+	publicKey  []byte
+}
+
+// generateSSHCredentials ensures an SSH keypair for every git server configured with an
+// ssh:// or git@ URL: it reuses a keypair already on disk for the host or else generates and
+// writes a new one, and adds a matching ssh config Host stanza. Only a newly generated public
+// key is uploaded to the provider, and only if an API token is available
+func (o *StepGitCredentialsOptions) generateSSHCredentials(authConfigSvc auth.ConfigService) error {
+	cfg := authConfigSvc.Config()
+	if cfg == nil {
+		return errors.New("no git auth config found")
+	}
+
+	for _, server := range cfg.Servers {
+		if !isSSHURL(server.URL) {
+			continue
+		}
+
+		gitAuth := server.CurrentAuth()
+
+		host := o.SSHHostname
+		if host == "" {
+			host = sshHostFromURL(server.URL)
+		}
+
+		sshDir, err := util.SSHDir()
+		if err != nil {
+			return err
+		}
+		keyFile := sshKeyFilePath(sshDir, host)
+
+		keyPair, err := loadSSHKeyPair(keyFile, host)
+		alreadyExists := keyPair != nil
+		if err != nil {
+			return errors.Wrapf(err, "reading existing ssh key for host %s", host)
+		}
+		if keyPair == nil {
+			keyPair, err = o.generateSSHKeyPair(host)
+			if err != nil {
+				return errors.Wrapf(err, "generating ssh keypair for host %s", host)
+			}
+
+			if err := o.writeSSHPrivateKey(keyPair); err != nil {
+				return errors.Wrapf(err, "writing ssh private key for host %s", host)
+			}
+		} else {
+			log.Logger().Infof("Reusing existing SSH key pair %s", util.ColorInfo(keyFile))
+		}
+
+		if err := o.appendSSHConfig(keyPair); err != nil {
+			return errors.Wrapf(err, "updating ssh config for host %s", host)
+		}
+
+		if alreadyExists {
+			continue
+		}
+
+		if gitAuth != nil && gitAuth.ApiToken != "" {
+			if err := o.uploadSSHPublicKey(server, gitAuth, keyPair); err != nil {
+				return errors.Wrapf(err, "uploading ssh public key for host %s", host)
+			}
+		} else {
+			log.Logger().Infof("No API token available for %s, skipping upload of public key", host)
+		}
+	}
+	return nil
+}
+
+// loadSSHKeyPair reads an already-generated private/public key pair for the given host from disk,
+// returning nil (with no error) if no such key pair exists yet, so callers can distinguish
+// "not generated yet" from a read failure and avoid regenerating and re-uploading a key on every
+// invocation
+func loadSSHKeyPair(keyFile string, host string) (*sshKeyPair, error) {
+	privatePEM, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	publicKey, err := ioutil.ReadFile(keyFile + ".pub")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &sshKeyPair{host: host, privatePEM: privatePEM, publicKey: publicKey}, nil
+}
+
+// generateSSHKeyPair creates a new keypair using the configured key algorithm
+func (o *StepGitCredentialsOptions) generateSSHKeyPair(host string) (*sshKeyPair, error) {
+	algorithm := o.KeyAlgorithm
+	if algorithm == "" {
+		algorithm = defaultKeyAlgorithm
+	}
+
+	var privateKeyBytes []byte
+	var publicKey ssh.PublicKey
+
+	switch strings.ToLower(algorithm) {
+	case "ed25519":
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "generating ed25519 key")
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "")
+		if err != nil {
+			return nil, errors.Wrap(err, "marshalling ed25519 private key")
+		}
+		privateKeyBytes = pem.EncodeToMemory(block)
+		publicKey, err = ssh.NewPublicKey(pub)
+		if err != nil {
+			return nil, errors.Wrap(err, "deriving ed25519 public key")
+		}
+	case "rsa":
+		bits := o.RSABits
+		if bits == 0 {
+			bits = defaultRSABits
+		}
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, errors.Wrap(err, "generating rsa key")
+		}
+		privateKeyBytes = pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(priv),
+		})
+		publicKey, err = ssh.NewPublicKey(&priv.PublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "deriving rsa public key")
+		}
+	case "ecdsa":
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "generating ecdsa key")
+		}
+		derBytes, err := x509.MarshalECPrivateKey(priv)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshalling ecdsa private key")
+		}
+		privateKeyBytes = pem.EncodeToMemory(&pem.Block{
+			Type:  "EC PRIVATE KEY",
+			Bytes: derBytes,
+		})
+		publicKey, err = ssh.NewPublicKey(&priv.PublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "deriving ecdsa public key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported --key-algorithm %q, must be one of: ed25519, rsa, ecdsa", algorithm)
+	}
+
+	return &sshKeyPair{
+		host:       host,
+		privatePEM: privateKeyBytes,
+		publicKey:  ssh.MarshalAuthorizedKey(publicKey),
+	}, nil
+}
+
+// writeSSHPrivateKey writes the private key to ~/.ssh/id_jx_<host> with 0600 perms
+func (o *StepGitCredentialsOptions) writeSSHPrivateKey(keyPair *sshKeyPair) error {
+	sshDir, err := util.SSHDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(sshDir, 0700); err != nil {
+		return errors.Wrapf(err, "creating ssh directory %s", sshDir)
+	}
+
+	keyFile := sshKeyFilePath(sshDir, keyPair.host)
+	if err := ioutil.WriteFile(keyFile, keyPair.privatePEM, 0600); err != nil {
+		return errors.Wrapf(err, "writing private key to %s", keyFile)
+	}
+
+	pubFile := keyFile + ".pub"
+	if err := ioutil.WriteFile(pubFile, keyPair.publicKey, 0644); err != nil {
+		return errors.Wrapf(err, "writing public key to %s", pubFile)
+	}
+
+	log.Logger().Infof("Generated SSH key pair %s", util.ColorInfo(keyFile))
+	return nil
+}
+
+// appendSSHConfig appends a Host ... IdentityFile ... stanza for the given keypair to ~/.ssh/config
+func (o *StepGitCredentialsOptions) appendSSHConfig(keyPair *sshKeyPair) error {
+	sshDir, err := util.SSHDir()
+	if err != nil {
+		return err
+	}
+
+	configFile := filepath.Join(sshDir, "config")
+	keyFile := sshKeyFilePath(sshDir, keyPair.host)
+
+	stanza := fmt.Sprintf("\nHost %s\n  IdentityFile %s\n  IdentitiesOnly yes\n", keyPair.host, keyFile)
+
+	existing, err := ioutil.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "reading ssh config %s", configFile)
+	}
+	if strings.Contains(string(existing), "Host "+keyPair.host) {
+		log.Logger().Infof("SSH config already contains a Host entry for %s, leaving it unchanged", keyPair.host)
+		return nil
+	}
+
+	f, err := os.OpenFile(configFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "opening ssh config %s", configFile)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(stanza); err != nil {
+		return errors.Wrapf(err, "writing ssh config %s", configFile)
+	}
+	return nil
+}
+
+// uploadSSHPublicKey uploads the public key to the git provider using the existing gits client
+func (o *StepGitCredentialsOptions) uploadSSHPublicKey(server *auth.AuthServer, gitAuth *auth.UserAuth, keyPair *sshKeyPair) error {
+	provider, err := gits.CreateProvider(server, gitAuth, o.Git())
+	if err != nil {
+		return errors.Wrap(err, "creating git provider")
+	}
+
+	title := fmt.Sprintf("jx-%s", keyPair.host)
+	if err := provider.AddUserKey(title, string(keyPair.publicKey)); err != nil {
+		return errors.Wrap(err, "uploading public key to git provider")
+	}
+	log.Logger().Infof("Uploaded SSH public key %s to %s", util.ColorInfo(title), util.ColorInfo(server.URL))
+	return nil
+}
+
+// isSSHURL returns true if the given git server URL uses the ssh:// scheme or the git@host shorthand
+func isSSHURL(rawURL string) bool {
+	if strings.HasPrefix(rawURL, "git@") {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "ssh"
+}
+
+// sshHostFromURL extracts the hostname from a ssh:// or git@host git server URL
+func sshHostFromURL(rawURL string) string {
+	if strings.HasPrefix(rawURL, "git@") {
+		rest := strings.TrimPrefix(rawURL, "git@")
+		if idx := strings.IndexAny(rest, ":/"); idx >= 0 {
+			return rest[:idx]
+		}
+		return rest
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Hostname()
+}
+
+// sshKeyFilePath returns the path to the generated private key for the given host
+func sshKeyFilePath(sshDir string, host string) string {
+	return filepath.Join(sshDir, "id_jx_"+host)
+}
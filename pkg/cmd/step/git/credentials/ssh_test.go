@@ -0,0 +1,71 @@
+package credentials
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSSHURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"git@github.com:jenkins-x/jx.git", true},
+		{"ssh://git@github.com/jenkins-x/jx.git", true},
+		{"https://github.com/jenkins-x/jx.git", false},
+		{"http://github.com/jenkins-x/jx.git", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isSSHURL(tt.url), "url %q", tt.url)
+	}
+}
+
+func TestSSHHostFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"git@github.com:jenkins-x/jx.git", "github.com"},
+		{"git@github.mycompany.com:org/repo.git", "github.mycompany.com"},
+		{"ssh://git@github.com/jenkins-x/jx.git", "github.com"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, sshHostFromURL(tt.url), "url %q", tt.url)
+	}
+}
+
+func TestSSHKeyFilePath(t *testing.T) {
+	assert.Equal(t, filepath.Join("/home/jx/.ssh", "id_jx_github.com"), sshKeyFilePath("/home/jx/.ssh", "github.com"))
+}
+
+func TestLoadSSHKeyPairMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshkeys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyPair, err := loadSSHKeyPair(sshKeyFilePath(dir, "github.com"), "github.com")
+	require.NoError(t, err)
+	assert.Nil(t, keyPair)
+}
+
+func TestLoadSSHKeyPairExisting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshkeys")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	keyFile := sshKeyFilePath(dir, "github.com")
+	require.NoError(t, ioutil.WriteFile(keyFile, []byte("private"), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile+".pub", []byte("public"), 0644))
+
+	keyPair, err := loadSSHKeyPair(keyFile, "github.com")
+	require.NoError(t, err)
+	require.NotNil(t, keyPair)
+	assert.Equal(t, "private", string(keyPair.privatePEM))
+	assert.Equal(t, "public", string(keyPair.publicKey))
+	assert.Equal(t, "github.com", keyPair.host)
+}
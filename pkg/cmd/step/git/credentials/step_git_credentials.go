@@ -1,12 +1,12 @@
 package credentials
 
 import (
-	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/url"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/jenkins-x/jx/pkg/auth"
 	"github.com/jenkins-x/jx/pkg/cmd/opts/step"
@@ -27,6 +27,15 @@ import (
 const (
 	optionOutputFile     = "output"
 	optionGitHubAppOwner = "github-app-owner"
+
+	// defaultKeyAlgorithm is used when --key-algorithm is not specified
+	defaultKeyAlgorithm = "ed25519"
+
+	// defaultRSABits is used when --rsa-bits is not specified
+	defaultRSABits = 4096
+
+	// defaultFormat is used when --format is not specified
+	defaultFormat = "git-store"
 )
 
 // StepGitCredentialsOptions contains the command line flags
@@ -37,6 +46,19 @@ type StepGitCredentialsOptions struct {
 	GitHubAppOwner    string
 	GitKind           string
 	CredentialsSecret string
+
+	SSH          bool
+	SSHOnly      bool
+	KeyAlgorithm string
+	RSABits      int
+	SSHHostname  string
+
+	GitHubAppSecret string
+	RefreshInterval time.Duration
+
+	Sources []string
+
+	Format string
 }
 
 type credentials struct {
@@ -82,6 +104,14 @@ func NewCmdStepGitCredentials(commonOpts *opts.CommonOptions) *cobra.Command {
 	cmd.Flags().StringVarP(&options.GitHubAppOwner, optionGitHubAppOwner, "g", "", "The owner (organisation or user name) if using GitHub App based tokens")
 	cmd.Flags().StringVarP(&options.CredentialsSecret, "credentials-secret", "s", "", "The secret name to read the credentials from")
 	cmd.Flags().StringVarP(&options.GitKind, "git-kind", "", "", "The git kind. e.g. github, bitbucketserver etc")
+	cmd.Flags().BoolVarP(&options.SSH, "ssh", "", false, "Also generate SSH credentials for git servers in the jx auth config using ssh:// or git@ URLs, alongside the HTTPS credentials file. Not applied when credentials come from --source, --credentials-secret or a GitHub App secret")
+	cmd.Flags().StringVarP(&options.KeyAlgorithm, "key-algorithm", "", defaultKeyAlgorithm, "The SSH key algorithm to use when --ssh is set. One of: ed25519, rsa, ecdsa")
+	cmd.Flags().IntVarP(&options.RSABits, "rsa-bits", "", defaultRSABits, "The number of bits to use when --key-algorithm is rsa")
+	cmd.Flags().StringVarP(&options.SSHHostname, "ssh-hostname", "", "", "Overrides the host used in the generated ssh config Host stanza. Defaults to the host of the git server URL")
+	cmd.Flags().StringVarP(&options.GitHubAppSecret, optionGitHubAppSecret, "", "", "The secret name containing githubAppId, githubAppInstallationId and privateKey, used to mint short-lived installation tokens")
+	cmd.Flags().DurationVarP(&options.RefreshInterval, "refresh-interval", "", 0, "If non-zero, keeps running and rewrites the credentials file with a fresh GitHub App installation token before it expires")
+	cmd.Flags().StringArrayVarP(&options.Sources, optionSource, "", nil, "A credential source to sync from, e.g. vault://secret/data/git/github?field=token&url=https://github.com. Can be repeated. Defaults to credential-sources.yaml if present")
+	cmd.Flags().StringVarP(&options.Format, "format", "", defaultFormat, "The output format to write the credentials in. One of: git-store, netrc, askpass, docker-config, json")
 	return cmd
 }
 
@@ -96,6 +126,60 @@ func (o *StepGitCredentialsOptions) Run() error {
 		return err
 	}
 
+	sources, err := o.credentialSources()
+	if err != nil {
+		return err
+	}
+	if len(sources) > 0 {
+		var allCredentials []credentials
+		for _, source := range sources {
+			creds, err := source.Fetch()
+			if err != nil {
+				return errors.Wrap(err, "fetching credentials from source")
+			}
+			allCredentials = append(allCredentials, creds...)
+		}
+		return o.createGitCredentialsFile(outFile, allCredentials)
+	}
+
+	githubAppSecretName := o.GitHubAppSecret
+	if githubAppSecretName == "" {
+		githubAppSecretName = o.CredentialsSecret
+	}
+	if githubAppSecretName != "" {
+		kubeClient, ns, err := o.KubeClientAndDevNamespace()
+		if err != nil {
+			return err
+		}
+
+		secret, err := kubeClient.CoreV1().Secrets(ns).Get(githubAppSecretName, metav1.GetOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to find secret '%s' in namespace '%s'", githubAppSecretName, ns)
+		}
+
+		if isGitHubAppSecret(secret) {
+			if o.RefreshInterval > 0 {
+				return o.runWithGitHubAppRefresh(outFile, secret)
+			}
+			creds, err := o.createGitHubAppCredentials(secret)
+			if err != nil {
+				return errors.Wrap(err, "creating github app credentials")
+			}
+			return o.createGitCredentialsFile(outFile, []credentials{*creds})
+		}
+
+		// Not a GitHub App secret. If it's the same secret named by --credentials-secret, reuse
+		// the copy already fetched above instead of fetching it again.
+		if githubAppSecretName == o.CredentialsSecret {
+			creds := credentials{
+				user:       string(secret.Data["user"]),
+				password:   string(secret.Data["token"]),
+				serviceURL: string(secret.Data["url"]),
+			}
+			return o.createGitCredentialsFile(outFile, []credentials{creds})
+		}
+	}
+
 	if o.CredentialsSecret != "" {
 		// get secret
 		kubeClient, ns, err := o.KubeClientAndDevNamespace()
@@ -144,34 +228,68 @@ func (o *StepGitCredentialsOptions) Run() error {
 	if err != nil {
 		return errors.Wrap(err, "creating git credentials")
 	}
+
+	if o.SSH {
+		if err := o.generateSSHCredentials(authConfigSvc); err != nil {
+			return errors.Wrap(err, "generating ssh credentials")
+		}
+		if o.SSHOnly {
+			return nil
+		}
+	}
 	return o.createGitCredentialsFile(outFile, credentials)
 }
 
+// GitCredentialsFileData renders the given credentials using the configured --format, defaulting
+// to the git-credential-store format
 func (o *StepGitCredentialsOptions) GitCredentialsFileData(credentials []credentials) ([]byte, error) {
-	var buffer bytes.Buffer
-	for _, creds := range credentials {
-		u, err := url.Parse(creds.serviceURL)
-		if err != nil {
-			log.Logger().Warnf("Ignoring invalid git service URL %q", creds.serviceURL)
-			continue
-		}
+	formatter, err := o.formatter()
+	if err != nil {
+		return nil, err
+	}
+	return formatter.Format(credentials)
+}
 
-		u.User = url.UserPassword(creds.user, creds.password)
-		buffer.WriteString(u.String() + "\n")
-		// Write the https protocol in case only https is set for completeness
-		if u.Scheme == "http" {
-			u.Scheme = "https"
-			buffer.WriteString(u.String() + "\n")
-		}
+// resolvedFormat returns the configured --format flag, defaulting to defaultFormat
+func (o *StepGitCredentialsOptions) resolvedFormat() string {
+	if o.Format == "" {
+		return defaultFormat
 	}
+	return o.Format
+}
 
-	return buffer.Bytes(), nil
+// formatter selects the Formatter for the configured --format flag
+func (o *StepGitCredentialsOptions) formatter() (Formatter, error) {
+	format := o.resolvedFormat()
+
+	switch format {
+	case "git-store", "":
+		return &gitStoreFormatter{}, nil
+	case "netrc":
+		return &netrcFormatter{}, nil
+	case "askpass":
+		return &askpassFormatter{}, nil
+	case "docker-config":
+		return &dockerConfigFormatter{}, nil
+	case "json":
+		return &jsonFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --format %q, must be one of: git-store, netrc, askpass, docker-config, json", format)
+	}
 }
 
 func (o *StepGitCredentialsOptions) determineOutputFile() (string, error) {
 	outFile := o.OutputFile
 	if outFile == "" {
-		outFile = util.GitCredentialsFile()
+		if o.resolvedFormat() == "docker-config" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", errors.Wrap(err, "finding user home directory")
+			}
+			outFile = filepath.Join(home, ".docker", "config.json")
+		} else {
+			outFile = util.GitCredentialsFile()
+		}
 	}
 
 	dir, _ := filepath.Split(outFile)
@@ -191,6 +309,13 @@ func (o *StepGitCredentialsOptions) createGitCredentialsFile(fileName string, cr
 		return errors.Wrap(err, "creating git credentials")
 	}
 
+	if o.resolvedFormat() == "docker-config" {
+		data, err = mergeDockerConfig(fileName, data)
+		if err != nil {
+			return errors.Wrap(err, "merging docker config")
+		}
+	}
+
 	if err := ioutil.WriteFile(fileName, data, util.DefaultWritePermissions); err != nil {
 		return fmt.Errorf("failed to write to %s: %s", fileName, err)
 	}
@@ -198,6 +323,38 @@ func (o *StepGitCredentialsOptions) createGitCredentialsFile(fileName string, cr
 	return nil
 }
 
+// mergeDockerConfig merges the newly generated `auths` entries into any existing docker config
+// file at fileName, so that entries for other registries (and settings such as credsStore) added
+// by `docker login` or other tooling are preserved rather than clobbered
+func mergeDockerConfig(fileName string, newData []byte) ([]byte, error) {
+	var newCfg dockerConfigFile
+	if err := json.Unmarshal(newData, &newCfg); err != nil {
+		return nil, errors.Wrap(err, "parsing generated docker config")
+	}
+
+	existing := map[string]interface{}{}
+	if data, err := ioutil.ReadFile(fileName); err == nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return nil, errors.Wrapf(err, "parsing existing docker config %s", fileName)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "reading existing docker config %s", fileName)
+	}
+	if existing == nil {
+		existing = map[string]interface{}{}
+	}
+	auths, _ := existing["auths"].(map[string]interface{})
+	if auths == nil {
+		auths = map[string]interface{}{}
+	}
+	for host, entry := range newCfg.Auths {
+		auths[host] = entry
+	}
+	existing["auths"] = auths
+
+	return json.MarshalIndent(existing, "", "  ")
+}
+
 // CreateGitCredentialsFromAuthService creates the git credentials using the auth config service
 func (o *StepGitCredentialsOptions) CreateGitCredentialsFromAuthService(authConfigSvc auth.ConfigService) ([]credentials, error) {
 	var credentialList []credentials
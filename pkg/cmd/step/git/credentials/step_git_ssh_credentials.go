@@ -0,0 +1,54 @@
+package credentials
+
+import (
+	"github.com/jenkins-x/jx/pkg/cmd/helper"
+	"github.com/jenkins-x/jx/pkg/cmd/opts"
+	"github.com/jenkins-x/jx/pkg/cmd/opts/step"
+	"github.com/jenkins-x/jx/pkg/cmd/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	StepGitSSHCredentialsLong = templates.LongDesc(`
+		This pipeline step generates SSH credentials for git servers configured with an ssh:// or git@ URL
+
+`)
+
+	StepGitSSHCredentialsExample = templates.Examples(`
+		# generate SSH credentials for any configured git servers using ssh:// or git@ URLs
+		jx step git ssh-credentials
+
+		# generate RSA credentials instead of the default ed25519
+		jx step git ssh-credentials --key-algorithm rsa --rsa-bits 4096
+`)
+)
+
+// NewCmdStepGitSSHCredentials creates the command
+func NewCmdStepGitSSHCredentials(commonOpts *opts.CommonOptions) *cobra.Command {
+	options := StepGitCredentialsOptions{
+		StepOptions: step.StepOptions{
+			CommonOptions: commonOpts,
+		},
+		SSH:     true,
+		SSHOnly: true,
+	}
+	cmd := &cobra.Command{
+		Use:     "ssh-credentials",
+		Short:   "Creates SSH credentials for the current pipeline's git servers",
+		Long:    StepGitSSHCredentialsLong,
+		Example: StepGitSSHCredentialsExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			options.Cmd = cmd
+			options.Args = args
+			err := options.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&options.GitHubAppOwner, optionGitHubAppOwner, "g", "", "The owner (organisation or user name) if using GitHub App based tokens")
+	cmd.Flags().StringVarP(&options.CredentialsSecret, "credentials-secret", "s", "", "The secret name to read the credentials from")
+	cmd.Flags().StringVarP(&options.GitKind, "git-kind", "", "", "The git kind. e.g. github, bitbucketserver etc")
+	cmd.Flags().StringVarP(&options.KeyAlgorithm, "key-algorithm", "", defaultKeyAlgorithm, "The SSH key algorithm to use. One of: ed25519, rsa, ecdsa")
+	cmd.Flags().IntVarP(&options.RSABits, "rsa-bits", "", defaultRSABits, "The number of bits to use when --key-algorithm is rsa")
+	cmd.Flags().StringVarP(&options.SSHHostname, "ssh-hostname", "", "", "Overrides the host used in the generated ssh config Host stanza. Defaults to the host of the git server URL")
+	return cmd
+}